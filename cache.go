@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CEPs are effectively immutable, so a long TTL is the sane default; it
+// mainly exists to let stale entries eventually self-heal if a provider's
+// data was ever wrong.
+const defaultCacheTTL = 30 * 24 * time.Hour
+
+// CacheStats summarizes accumulated hit/miss counts and, for a persistent
+// cache, how often each provider's answer ended up cached.
+type CacheStats struct {
+	Hits         int64
+	Misses       int64
+	ProviderWins map[string]int64
+}
+
+// Cache stores normalized CEP lookups keyed by cep+provider-whitelist.
+type Cache interface {
+	Get(key string) (*CEPInfo, bool)
+	Set(key string, info *CEPInfo)
+	Stats() CacheStats
+}
+
+// noopCache disables caching entirely; it backs the -no-cache flag.
+type noopCache struct{}
+
+func (noopCache) Get(string) (*CEPInfo, bool) { return nil, false }
+func (noopCache) Set(string, *CEPInfo)        {}
+func (noopCache) Stats() CacheStats           { return CacheStats{} }
+
+var (
+	cacheMu     sync.RWMutex
+	sharedCache Cache = NewLRUCache(256, defaultCacheTTL)
+	lookupGroup singleflight.Group
+)
+
+// SetCache replaces the cache used by GetCEPContext for every subsequent
+// lookup.
+func SetCache(c Cache) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	sharedCache = c
+}
+
+// ActiveCache returns the cache currently used by GetCEPContext.
+func ActiveCache() Cache {
+	cacheMu.RLock()
+	defer cacheMu.RUnlock()
+	return sharedCache
+}
+
+// cacheKey identifies a lookup by both the CEP and the provider whitelist,
+// so narrowing -providers on a later call can't serve a result won by a
+// provider that is no longer in scope.
+func cacheKey(cep string, providerNames []string) string {
+	if len(providerNames) == 0 {
+		return cep
+	}
+	names := append([]string(nil), providerNames...)
+	sort.Strings(names)
+	return cep + "|" + strings.Join(names, ",")
+}
+
+type cacheEntry struct {
+	Key       string    `json:"key"`
+	Info      *CEPInfo  `json:"info"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e cacheEntry) expired() bool {
+	return time.Now().After(e.ExpiresAt)
+}
+
+// LRUCache is an in-memory, TTL-aware, capacity-bounded Cache.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	ll       *list.List
+	items    map[string]*list.Element
+	hits     int64
+	misses   int64
+}
+
+// NewLRUCache builds an LRUCache holding at most capacity entries (<= 0
+// means unbounded) for up to ttl each.
+func NewLRUCache(capacity int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (*CEPInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := el.Value.(cacheEntry)
+	if entry.expired() {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.hits++
+	return entry.Info, true
+}
+
+func (c *LRUCache) Set(key string, info *CEPInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cacheEntry{Key: key, Info: info, ExpiresAt: time.Now().Add(c.ttl)}
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(entry)
+	if c.capacity > 0 && c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(cacheEntry).Key)
+		}
+	}
+}
+
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wins := make(map[string]int64)
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(cacheEntry)
+		if !entry.expired() {
+			wins[entry.Info.Source]++
+		}
+	}
+
+	return CacheStats{Hits: c.hits, Misses: c.misses, ProviderWins: wins}
+}
+
+// fileCacheData is the on-disk representation persisted to cache.json.
+type fileCacheData struct {
+	Entries []cacheEntry `json:"entries"`
+	Hits    int64        `json:"hits"`
+	Misses  int64        `json:"misses"`
+}
+
+// FileCache is a Cache that persists every write to path, so lookups are
+// deduplicated across separate runs of the CLI as well as within one.
+type FileCache struct {
+	mu       sync.Mutex
+	path     string
+	capacity int
+	ttl      time.Duration
+	data     fileCacheData
+	index    map[string]int
+}
+
+// NewFileCache opens (or creates) the cache file at path.
+func NewFileCache(path string, capacity int, ttl time.Duration) (*FileCache, error) {
+	fc := &FileCache{
+		path:     path,
+		capacity: capacity,
+		ttl:      ttl,
+		index:    make(map[string]int),
+	}
+
+	if err := fc.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return fc, nil
+}
+
+func (fc *FileCache) load() error {
+	raw, err := os.ReadFile(fc.path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(raw, &fc.data); err != nil {
+		return err
+	}
+
+	for i, entry := range fc.data.Entries {
+		fc.index[entry.Key] = i
+	}
+	return nil
+}
+
+// save persists fc.data via a temp file plus rename, so a writer that dies
+// or races with another writer mid-write can never leave cache.json holding
+// a truncated or interleaved document.
+func (fc *FileCache) save() error {
+	dir := filepath.Dir(fc.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(fc.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".cache-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, fc.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Get bumps Hits/Misses in memory only, regardless of outcome: a hit
+// mutates nothing else on disk, and a miss is immediately followed by a
+// provider race and a Set that will persist it anyway, so saving here too
+// would cost a second full-file rewrite for the same lookup. Either counter
+// reaches disk on the next Set, or on an explicit Flush for a lookup that
+// never produces one (e.g. the race itself fails).
+func (fc *FileCache) Get(key string) (*CEPInfo, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	i, ok := fc.index[key]
+	if !ok {
+		fc.data.Misses++
+		return nil, false
+	}
+
+	entry := fc.data.Entries[i]
+	if entry.expired() {
+		fc.removeAt(i)
+		fc.data.Misses++
+		return nil, false
+	}
+
+	fc.data.Hits++
+	return entry.Info, true
+}
+
+// Flush persists whichever hit/miss counters Get has bumped in memory since
+// the last write. The CLI is a one-shot process, so without an explicit
+// flush before exit, a run that only ever hits (or only ever misses without
+// a following Set) never advances the persisted counters past whatever the
+// last write left them at.
+func (fc *FileCache) Flush() error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.save()
+}
+
+func (fc *FileCache) Set(key string, info *CEPInfo) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	entry := cacheEntry{Key: key, Info: info, ExpiresAt: time.Now().Add(fc.ttl)}
+	if i, ok := fc.index[key]; ok {
+		fc.data.Entries[i] = entry
+	} else {
+		if fc.capacity > 0 && len(fc.data.Entries) >= fc.capacity {
+			fc.removeAt(0)
+		}
+		fc.index[key] = len(fc.data.Entries)
+		fc.data.Entries = append(fc.data.Entries, entry)
+	}
+
+	if err := fc.save(); err != nil {
+		logger.Warn("failed to persist cache", "path", fc.path, "error", err)
+	}
+}
+
+// removeAt evicts the entry at index i and reindexes the entries after it.
+func (fc *FileCache) removeAt(i int) {
+	key := fc.data.Entries[i].Key
+	fc.data.Entries = append(fc.data.Entries[:i], fc.data.Entries[i+1:]...)
+	delete(fc.index, key)
+	for k, idx := range fc.index {
+		if idx > i {
+			fc.index[k] = idx - 1
+		}
+	}
+}
+
+func (fc *FileCache) Stats() CacheStats {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	wins := make(map[string]int64)
+	for _, entry := range fc.data.Entries {
+		if !entry.expired() {
+			wins[entry.Info.Source]++
+		}
+	}
+
+	return CacheStats{Hits: fc.data.Hits, Misses: fc.data.Misses, ProviderWins: wins}
+}
+
+// DefaultCachePath returns $XDG_CACHE_HOME/fastest-request/cache.json,
+// falling back to $HOME/.cache when XDG_CACHE_HOME is unset.
+func DefaultCachePath() string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "fastest-request", "cache.json")
+}
+
+// runCacheStats implements the `cache stats` subcommand: it opens the
+// persistent cache read-only and prints accumulated hit/miss counts and
+// each provider's share of the cached wins.
+func runCacheStats(progname string, args []string) error {
+	var path string
+	var buf bytes.Buffer
+
+	flags := flag.NewFlagSet(progname, flag.ContinueOnError)
+	flags.SetOutput(&buf)
+	flags.StringVar(&path, "cache-path", DefaultCachePath(), "cache-path overrides the persistent cache file to inspect.")
+
+	if err := flags.Parse(args); err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("%w: %w", ErrInvalidFlags, err))
+		fmt.Fprintln(os.Stderr, buf.String())
+		return err
+	}
+
+	fc, err := NewFileCache(path, 0, defaultCacheTTL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return err
+	}
+
+	stats := fc.Stats()
+	fmt.Fprintf(os.Stdout, "hits: %d\n", stats.Hits)
+	fmt.Fprintf(os.Stdout, "misses: %d\n", stats.Misses)
+
+	total := int64(0)
+	for _, n := range stats.ProviderWins {
+		total += n
+	}
+
+	providers := make([]string, 0, len(stats.ProviderWins))
+	for name := range stats.ProviderWins {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+
+	fmt.Fprintln(os.Stdout, "provider win rates:")
+	for _, name := range providers {
+		n := stats.ProviderWins[name]
+		rate := float64(0)
+		if total > 0 {
+			rate = float64(n) / float64(total) * 100
+		}
+		fmt.Fprintf(os.Stdout, "  %s: %d (%.1f%%)\n", name, n, rate)
+	}
+
+	return nil
+}
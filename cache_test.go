@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCacheGetSet(t *testing.T) {
+	c := NewLRUCache(2, time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("a", &CEPInfo{CEP: "a", Source: "viacep"})
+	info, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "viacep", info.Source)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+}
+
+func TestLRUCacheEvictsOverCapacity(t *testing.T) {
+	c := NewLRUCache(1, time.Minute)
+
+	c.Set("a", &CEPInfo{CEP: "a"})
+	c.Set("b", &CEPInfo{CEP: "b"})
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	c := NewLRUCache(0, time.Nanosecond)
+
+	c.Set("a", &CEPInfo{CEP: "a"})
+	time.Sleep(time.Millisecond)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
+
+func TestFileCachePersistsAcrossInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	fc1, err := NewFileCache(path, 0, time.Minute)
+	assert.NoError(t, err)
+	fc1.Set("69999999", &CEPInfo{CEP: "69999999", Source: "viacep"})
+
+	fc2, err := NewFileCache(path, 0, time.Minute)
+	assert.NoError(t, err)
+	info, ok := fc2.Get("69999999")
+	assert.True(t, ok)
+	assert.Equal(t, "viacep", info.Source)
+}
+
+func TestFileCacheFlushPersistsHitsWithNoIntervingWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	fc1, err := NewFileCache(path, 0, time.Minute)
+	assert.NoError(t, err)
+	fc1.Set("69999999", &CEPInfo{CEP: "69999999", Source: "viacep"})
+
+	fc2, err := NewFileCache(path, 0, time.Minute)
+	assert.NoError(t, err)
+	_, ok := fc2.Get("69999999")
+	assert.True(t, ok)
+	assert.NoError(t, fc2.Flush())
+
+	fc3, err := NewFileCache(path, 0, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), fc3.Stats().Hits)
+}
+
+func TestCacheKeyIncludesProviderWhitelist(t *testing.T) {
+	assert.Equal(t, "69999999", cacheKey("69999999", nil))
+	assert.Equal(t, "69999999|brasilapi,viacep", cacheKey("69999999", []string{"viacep", "brasilapi"}))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ClientConfig configures the dial, TLS handshake and response-header
+// timeouts used by the shared HTTP client, mirroring the guidance in
+// net/http's Transport docs so a slow-to-connect provider cannot starve a
+// fast one.
+type ClientConfig struct {
+	DialTimeout     time.Duration
+	TLSTimeout      time.Duration
+	HeaderTimeout   time.Duration
+	IdleConnTimeout time.Duration
+}
+
+// NewHTTPClient builds an *http.Client whose Transport enforces cfg's
+// connection-level deadlines independently of the per-request context
+// deadline.
+func NewHTTPClient(cfg ClientConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.TLSTimeout,
+			ResponseHeaderTimeout: cfg.HeaderTimeout,
+			IdleConnTimeout:       cfg.IdleConnTimeout,
+		},
+	}
+}
+
+var (
+	clientMu     sync.RWMutex
+	sharedClient = NewHTTPClient(ClientConfig{
+		DialTimeout:     5 * time.Second,
+		TLSTimeout:      5 * time.Second,
+		HeaderTimeout:   5 * time.Second,
+		IdleConnTimeout: 90 * time.Second,
+	})
+)
+
+// SetHTTPClient replaces the client used by makeRequest for every
+// subsequent provider race.
+func SetHTTPClient(c *http.Client) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	sharedClient = c
+}
+
+// HTTPClient returns the client currently used by makeRequest.
+func HTTPClient() *http.Client {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	return sharedClient
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// configureLogger rebuilds the package logger and installs it as the
+// slog default. format is "text" or "json"; level is anything
+// slog.Level.UnmarshalText accepts ("debug", "info", "warn", "error").
+func configureLogger(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("%w: log-level", ErrInvalidFlags)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("%w: log-format %q", ErrInvalidFlags, format)
+	}
+
+	logger = slog.New(handler)
+	slog.SetDefault(logger)
+	return nil
+}
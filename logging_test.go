@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureLoggerWithInvalidFormat(t *testing.T) {
+	err := configureLogger("yaml", "info")
+	assert.ErrorIs(t, err, ErrInvalidFlags)
+}
+
+func TestConfigureLoggerWithInvalidLevel(t *testing.T) {
+	err := configureLogger("json", "loud")
+	assert.ErrorIs(t, err, ErrInvalidFlags)
+}
+
+func TestConfigureLoggerWithValidFlags(t *testing.T) {
+	assert.NoError(t, configureLogger("json", "debug"))
+	assert.NoError(t, configureLogger("text", "warn"))
+}
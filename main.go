@@ -7,14 +7,36 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	timeoutUsage = `timeout define a limit to make all requests. Examples 300ms, -1.5h or "2h45m".
 Valid time units are "ns", "us" (or "Âµs"), "ms", "s", "m", "h".`
+
+	providersUsage = `providers restricts the race to a comma-separated whitelist of provider
+names (e.g. "viacep,brasilapi"). Defaults to every registered provider.`
+
+	retriesUsage      = "retries sets how many times a provider is retried after a transient error before giving up."
+	retryBackoffUsage = `retry-backoff sets the base delay between retries, doubled on each attempt
+and randomized with jitter. Examples 100ms, 1s.`
+	dialTimeoutUsage   = "dial-timeout caps how long a provider's TCP connection may take to establish."
+	tlsTimeoutUsage    = "tls-timeout caps how long a provider's TLS handshake may take."
+	headerTimeoutUsage = "header-timeout caps how long to wait for a provider's response headers after the request is sent."
+
+	logFormatUsage    = `log-format selects the log encoding, "text" or "json".`
+	logLevelUsage     = `log-level selects the minimum log level, e.g. "debug", "info", "warn", "error".`
+	otlpEndpointUsage = "otlp-endpoint is the OTLP/gRPC collector address to export traces to. Leave empty to disable tracing."
+
+	cacheSizeUsage = "cache-size caps how many CEPs the persistent cache keeps (<= 0 means unbounded)."
+	cacheTTLUsage  = "cache-ttl sets how long a cached CEP stays valid. CEPs rarely change, so the default is long."
+	noCacheUsage   = "no-cache bypasses the cache entirely, always racing the providers."
 )
 
 var (
@@ -24,36 +46,138 @@ var (
 )
 
 func main() {
-	flags, usage, err := ParseCLIFlags(os.Args[0], os.Args[1:])
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := runServe(os.Args[0], os.Args[2:]); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 2 && os.Args[1] == "cache" && os.Args[2] == "stats" {
+		if err := runCacheStats(os.Args[0], os.Args[3:]); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(os.Args[0], os.Args[1:]); err != nil {
+		os.Exit(1)
+	}
+}
+
+// run executes the single-lookup CLI path and returns any failure instead of
+// calling os.Exit directly, so main can let its deferred shutdownTracing
+// flush (os.Exit skips deferred functions, and tracing.go documents that the
+// shutdown func must run before the process exits).
+func run(progname string, args []string) error {
+	flags, usage, err := ParseCLIFlags(progname, args)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		fmt.Fprintln(os.Stderr, usage)
-		os.Exit(1)
+		return err
 	}
 
-	resp, err := GetCEP(flags.cep, flags.timeout)
+	if err := configureLogger(flags.logFormat, flags.logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	ctx := context.Background()
+	shutdownTracing, err := configureTracing(ctx, flags.otlpEndpoint)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+	defer shutdownTracing(ctx)
+
+	SetHTTPClient(NewHTTPClient(ClientConfig{
+		DialTimeout:     flags.dialTimeout,
+		TLSTimeout:      flags.tlsTimeout,
+		HeaderTimeout:   flags.headerTimeout,
+		IdleConnTimeout: 90 * time.Second,
+	}))
+	SetRetryPolicy(RetryPolicy{
+		MaxRetries: flags.retries,
+		Backoff:    flags.retryBackoff,
+	})
+
+	if flags.noCache {
+		SetCache(noopCache{})
+	} else if fileCache, err := NewFileCache(DefaultCachePath(), flags.cacheSize, flags.cacheTTL); err != nil {
+		logger.Warn("failed to open persistent cache, falling back to in-memory", "error", err)
+		SetCache(NewLRUCache(flags.cacheSize, flags.cacheTTL))
+	} else {
+		SetCache(fileCache)
+		// The CLI is one-shot: a run that only ever hits the cache has no
+		// later miss/write to flush the bumped hit counter, so cache stats
+		// would otherwise under-report indefinitely.
+		defer func() {
+			if err := fileCache.Flush(); err != nil {
+				logger.Warn("failed to flush cache stats", "error", err)
+			}
+		}()
+	}
+
+	resp, err := GetCEP(flags.cep, flags.timeout, flags.providers...)
+	if err != nil {
+		logger.Error("cep lookup failed", "cep", flags.cep, "error", err)
+		return err
 	}
 
 	fmt.Fprintf(os.Stdout, "%+v\n", resp)
+	return nil
 }
 
 type CLIFlags struct {
-	cep     string
-	timeout time.Duration
+	cep           string
+	timeout       time.Duration
+	providers     []string
+	retries       int
+	retryBackoff  time.Duration
+	dialTimeout   time.Duration
+	tlsTimeout    time.Duration
+	headerTimeout time.Duration
+	logFormat     string
+	logLevel      string
+	otlpEndpoint  string
+	cacheSize     int
+	cacheTTL      time.Duration
+	noCache       bool
 }
 
 func ParseCLIFlags(progname string, args []string) (cliFlags *CLIFlags, usage string, err error) {
 	var cep string
 	var timeoutStr string
+	var providersStr string
+	var retries int
+	var retryBackoffStr string
+	var dialTimeoutStr string
+	var tlsTimeoutStr string
+	var headerTimeoutStr string
+	var logFormat string
+	var logLevel string
+	var otlpEndpoint string
+	var cacheSize int
+	var cacheTTLStr string
+	var noCache bool
 	var buf bytes.Buffer
 
 	flags := flag.NewFlagSet(progname, flag.ContinueOnError)
 	flags.SetOutput(&buf)
 	flags.StringVar(&cep, "cep", "", "make a cep request")
 	flags.StringVar(&timeoutStr, "timeout", "1s", timeoutUsage)
+	flags.StringVar(&providersStr, "providers", "", providersUsage)
+	flags.IntVar(&retries, "retries", 2, retriesUsage)
+	flags.StringVar(&retryBackoffStr, "retry-backoff", "100ms", retryBackoffUsage)
+	flags.StringVar(&dialTimeoutStr, "dial-timeout", "5s", dialTimeoutUsage)
+	flags.StringVar(&tlsTimeoutStr, "tls-timeout", "5s", tlsTimeoutUsage)
+	flags.StringVar(&headerTimeoutStr, "header-timeout", "5s", headerTimeoutUsage)
+	flags.StringVar(&logFormat, "log-format", "text", logFormatUsage)
+	flags.StringVar(&logLevel, "log-level", "info", logLevelUsage)
+	flags.StringVar(&otlpEndpoint, "otlp-endpoint", "", otlpEndpointUsage)
+	flags.IntVar(&cacheSize, "cache-size", 256, cacheSizeUsage)
+	flags.StringVar(&cacheTTLStr, "cache-ttl", defaultCacheTTL.String(), cacheTTLUsage)
+	flags.BoolVar(&noCache, "no-cache", false, noCacheUsage)
 
 	err = flags.Parse(args)
 	if buf.Len() == 0 {
@@ -77,29 +201,163 @@ func ParseCLIFlags(progname string, args []string) (cliFlags *CLIFlags, usage st
 		return
 	}
 
+	retryBackoff, err := time.ParseDuration(retryBackoffStr)
+	if err != nil {
+		err = fmt.Errorf("%w: retry-backoff", ErrInvalidTimeout)
+		return
+	}
+
+	dialTimeout, err := time.ParseDuration(dialTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: dial-timeout", ErrInvalidTimeout)
+		return
+	}
+
+	tlsTimeout, err := time.ParseDuration(tlsTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: tls-timeout", ErrInvalidTimeout)
+		return
+	}
+
+	headerTimeout, err := time.ParseDuration(headerTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: header-timeout", ErrInvalidTimeout)
+		return
+	}
+
+	cacheTTL, err := time.ParseDuration(cacheTTLStr)
+	if err != nil {
+		err = fmt.Errorf("%w: cache-ttl", ErrInvalidTimeout)
+		return
+	}
+
 	cliFlags = &CLIFlags{
-		cep:     cep,
-		timeout: timeout,
+		cep:           cep,
+		timeout:       timeout,
+		providers:     splitProviderNames(providersStr),
+		retries:       retries,
+		retryBackoff:  retryBackoff,
+		dialTimeout:   dialTimeout,
+		tlsTimeout:    tlsTimeout,
+		headerTimeout: headerTimeout,
+		logFormat:     logFormat,
+		logLevel:      logLevel,
+		otlpEndpoint:  otlpEndpoint,
+		cacheSize:     cacheSize,
+		cacheTTL:      cacheTTL,
+		noCache:       noCache,
 	}
 	return
 }
 
-func GetCEP(cep string, timeout time.Duration) (*Response, error) {
+func splitProviderNames(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	parts := strings.Split(s, ",")
+	names := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if name := strings.TrimSpace(part); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GetCEP races every provider in providerNames (or every registered provider,
+// if none are given) and returns the normalized result of whichever
+// responds successfully first. The race runs within timeout of the call.
+func GetCEP(cep string, timeout time.Duration, providerNames ...string) (*CEPInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	urls := []string{
-		"https://cdn.apicep.com/file/apicep/" + cep + ".json",
-		"http://viacep.com.br/ws/" + cep + "/json/",
+	return GetCEPContext(ctx, cep, providerNames...)
+}
+
+// maxRaceTimeout caps how long a detached provider race may run when the
+// leader's own deadline is missing or implausibly long, so a sustained
+// stream of requests against a long-lived serve process can't accumulate
+// goroutines and connections past any bound at all.
+const maxRaceTimeout = 30 * time.Second
+
+// raceBudget derives how long the detached race DoChan starts on behalf of
+// ctx's caller (the race's "leader") may run. It uses the leader's own
+// deadline rather than maxRaceTimeout whenever that deadline is the tighter
+// of the two, so a caller with a short -timeout/?timeout doesn't leave
+// server-side requests running well past what it actually asked for.
+func raceBudget(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < maxRaceTimeout {
+			return remaining
+		}
 	}
+	return maxRaceTimeout
+}
 
-	requestsReponseStream := MakeRequests(ctx, urls)
+// GetCEPContext is the context-aware core of GetCEP. It lets callers that
+// already carry a deadline (such as the HTTP server) bound the race without
+// creating a second, independent timeout. Lookups are served from the
+// active Cache when possible, and concurrent lookups of the same CEP and
+// provider whitelist collapse into a single in-flight race.
+//
+// The race itself runs on DoChan rather than Do, on a context detached from
+// any single caller (bounded by raceBudget(ctx) instead of ctx itself). That
+// keeps a follower's own deadline or cancellation honored even while the
+// shared race it is waiting on keeps running for everyone else, while still
+// sizing that race's budget off the leader's own request.
+func GetCEPContext(ctx context.Context, cep string, providerNames ...string) (*CEPInfo, error) {
+	key := cacheKey(cep, providerNames)
+	cache := ActiveCache()
+
+	if info, ok := cache.Get(key); ok {
+		return info, nil
+	}
+
+	resultCh := lookupGroup.DoChan(key, func() (any, error) {
+		raceCtx, cancel := context.WithTimeout(context.Background(), raceBudget(ctx))
+		defer cancel()
+		return raceProviders(raceCtx, cep, providerNames...)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+
+	case res := <-resultCh:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		info := res.Val.(*CEPInfo)
+		cache.Set(key, info)
+		return info, nil
+	}
+}
+
+// raceProviders runs the actual provider race; it is the previous body of
+// GetCEPContext, split out so singleflight.DoChan has a plain function to call.
+func raceProviders(ctx context.Context, cep string, providerNames ...string) (*CEPInfo, error) {
+	ctx, span := tracer.Start(ctx, "GetCEP", trace.WithAttributes(
+		attribute.String("cep", cep),
+	))
+	defer span.End()
+
+	provs, err := SelectProviders(providerNames)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	requestsReponseStream := MakeRequests(ctx, cep, provs)
 
 	var respReceived int
 	var errs []error
-	for respReceived < len(urls) {
+	for respReceived < len(provs) {
 		select {
 		case <-ctx.Done():
+			span.SetStatus(codes.Error, ctx.Err().Error())
 			return nil, ctx.Err()
 
 		case result := <-requestsReponseStream:
@@ -109,74 +367,179 @@ func GetCEP(cep string, timeout time.Duration) (*Response, error) {
 				continue
 			}
 
+			recordWin(result.resp.Source)
+			span.SetAttributes(attribute.String("winner", result.resp.Source))
+			logger.Info("cep lookup won", "cep", cep, "provider", result.resp.Source)
 			return result.resp, nil
 		}
 	}
 
-	return nil, errors.Join(errs...)
-}
-
-type Response struct {
-	URL  string `json:"url"`
-	Data string `json:"data"`
+	err = errors.Join(errs...)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return nil, err
 }
 
 type RequestResult struct {
 	err  error
-	resp *Response
+	resp *CEPInfo
 }
 
-func MakeRequests(ctx context.Context, urls []string) <-chan *RequestResult {
+func MakeRequests(ctx context.Context, cep string, provs []Provider) <-chan *RequestResult {
 	stream := make(chan *RequestResult)
 
-	for _, url := range urls {
-		go makeRequest(ctx, stream, url)
+	for _, p := range provs {
+		go makeRequest(ctx, stream, p, cep)
 	}
 
 	return stream
 }
 
-func makeRequest(ctx context.Context, sender chan<- *RequestResult, url string) {
+// makeRequest drives a single provider to completion, retrying transient
+// failures per GetRetryPolicy before reporting a final result. A result is
+// only sent once the provider has either succeeded, hit a non-retriable
+// error, or exhausted its retries, so a provider that is still retrying does
+// not count as
+// "received" in GetCEP's race.
+func makeRequest(ctx context.Context, sender chan<- *RequestResult, p Provider, cep string) {
+	ctx, span := tracer.Start(ctx, "provider."+p.Name(), trace.WithAttributes(
+		attribute.String("provider", p.Name()),
+	))
+	defer span.End()
+
+	policy := GetRetryPolicy()
 	result := &RequestResult{}
+	start := time.Now()
+	attempt := 0
+	var bytesRead int64
+
+	defer func() {
+		recordRequest(p.Name())
+		recordLatency(p.Name(), time.Since(start))
+	}()
+
+	for ; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				markCanceledByWinner(span, ctx)
+				return
+			case <-time.After(policy.Wait(attempt - 1)):
+			}
+		}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		result.err = err
-		SendData(ctx, sender, result)
-		return
-	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		result.err = err
-		SendData(ctx, sender, result)
-		return
-	}
-	defer resp.Body.Close()
-
-	select {
-	case <-ctx.Done():
-		return
+		req, err := p.BuildRequest(ctx, cep)
+		if err != nil {
+			result.err = err
+			break
+		}
+		span.SetAttributes(attribute.String("url", req.URL.String()))
 
-	default:
-		buf := new(bytes.Buffer)
-		_, err = io.Copy(buf, resp.Body)
+		resp, err := HTTPClient().Do(req)
 		if err != nil {
+			// A losing provider's in-flight request aborts with a wrapped
+			// ctx-canceled error the moment the winner is chosen; that is
+			// the dominant real-world case, and it must be reported the
+			// same way as the explicit ctx.Done() checks below rather than
+			// as a generic request failure.
+			if ctx.Err() != nil {
+				markCanceledByWinner(span, ctx)
+				return
+			}
 			result.err = err
-			SendData(ctx, sender, result)
-			return
+			if attempt < policy.MaxRetries && isRetriableErr(err) {
+				continue
+			}
+			break
+		}
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+		if isRetriableStatus(resp.StatusCode) && attempt < policy.MaxRetries {
+			resp.Body.Close()
+			result.err = fmt.Errorf("%s: server error %d", p.Name(), resp.StatusCode)
+			continue
 		}
 
-		result.resp = &Response{
-			URL:  url,
-			Data: buf.String(),
+		select {
+		case <-ctx.Done():
+			resp.Body.Close()
+			markCanceledByWinner(span, ctx)
+			return
+
+		default:
+			resp.Body = &countingReadCloser{ReadCloser: resp.Body, n: &bytesRead}
+			info, err := p.Parse(resp)
+			resp.Body.Close()
+			if err != nil {
+				result.err = err
+			} else {
+				result.err = nil
+				result.resp = info
+			}
 		}
-		SendData(ctx, sender, result)
+		break
+	}
+
+	// Whether this goroutine actually won the race is decided by whether its
+	// send below is the one raceProviders receives, not by whether it has a
+	// nil err: the stream is unbuffered with a single reader, so a second
+	// successful parser's send loses to ctx cancellation just like an error
+	// would, and must not be reported as won.
+	sent := SendData(ctx, sender, result)
+	won := sent && result.err == nil
+
+	span.SetAttributes(
+		attribute.Int("retry_count", attempt),
+		attribute.Int64("bytes_read", bytesRead),
+		attribute.Bool("won", won),
+	)
+	switch {
+	case result.err != nil:
+		span.RecordError(result.err)
+		span.SetStatus(codes.Error, result.err.Error())
+	case !won:
+		markCanceledByWinner(span, ctx)
+	}
+
+	if result.err != nil {
+		recordError(p.Name(), classifyErr(result.err))
+	}
+}
+
+// markCanceledByWinner flags a span whose provider lost the race and was
+// canceled, as opposed to one that failed outright, so traces clearly show
+// cancellations caused by a faster sibling rather than a real error.
+func markCanceledByWinner(span trace.Span, ctx context.Context) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		span.SetStatus(codes.Error, "canceled_by_winner")
+		return
 	}
+	span.SetStatus(codes.Error, ctx.Err().Error())
+}
+
+// countingReadCloser wraps a response body to count bytes read through it,
+// so makeRequest can attach a bytes_read attribute without Provider.Parse
+// needing to know about tracing.
+type countingReadCloser struct {
+	io.ReadCloser
+	n *int64
 }
-func SendData[T any](ctx context.Context, sender chan<- T, data T) {
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// SendData sends data on sender unless ctx is done first, and reports
+// whether the send actually happened — callers that race multiple senders
+// against a single reader (such as makeRequest) use this to tell an accepted
+// send from one that lost the race to cancellation.
+func SendData[T any](ctx context.Context, sender chan<- T, data T) bool {
 	select {
 	case <-ctx.Done():
+		return false
 	case sender <- data:
+		return true
 	}
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastest_request_provider_requests_total",
+		Help: "Total lookups attempted per CEP provider.",
+	}, []string{"provider"})
+
+	winsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastest_request_provider_wins_total",
+		Help: "Total races won per CEP provider.",
+	}, []string{"provider"})
+
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastest_request_provider_errors_total",
+		Help: "Total lookup errors per CEP provider, broken down by kind.",
+	}, []string{"provider", "kind"})
+
+	latencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fastest_request_provider_latency_seconds",
+		Help:    "Latency of a provider lookup, whether or not it won the race.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, winsTotal, errorsTotal, latencySeconds)
+}
+
+func recordRequest(provider string) {
+	requestsTotal.WithLabelValues(provider).Inc()
+}
+
+func recordWin(provider string) {
+	winsTotal.WithLabelValues(provider).Inc()
+}
+
+func recordError(provider, kind string) {
+	errorsTotal.WithLabelValues(provider, kind).Inc()
+}
+
+func recordLatency(provider string, d time.Duration) {
+	latencySeconds.WithLabelValues(provider).Observe(d.Seconds())
+}
+
+// classifyErr buckets a lookup error into a small, stable set of labels
+// suitable for the errors_total metric.
+func classifyErr(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case isRetriableErr(err):
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+// metricsHandler exposes the registered metrics in the Prometheus text
+// exposition format.
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
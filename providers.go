@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// CEPInfo is the normalized result returned by GetCEP regardless of which
+// provider answered the race.
+type CEPInfo struct {
+	CEP        string `json:"cep"`
+	Logradouro string `json:"logradouro"`
+	Bairro     string `json:"bairro"`
+	Localidade string `json:"localidade"`
+	UF         string `json:"uf"`
+	Source     string `json:"source"`
+}
+
+// Provider builds the HTTP request for a given CEP against a specific
+// backend and parses its response into a CEPInfo. Implementations must be
+// safe for concurrent use.
+type Provider interface {
+	Name() string
+	BuildRequest(ctx context.Context, cep string) (*http.Request, error)
+	Parse(resp *http.Response) (*CEPInfo, error)
+}
+
+var ErrUnknownProvider = fmt.Errorf("unknown provider")
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{}
+)
+
+// Register adds p to the package-level registry, replacing any provider
+// already registered under the same name. It is typically called from an
+// init function, but is safe to call at any time.
+func Register(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name()] = p
+}
+
+// Providers returns every registered provider, sorted by name.
+func Providers() []Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	list := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// SelectProviders resolves a whitelist of provider names against the
+// registry. An empty names list selects every registered provider.
+func SelectProviders(names []string) ([]Provider, error) {
+	if len(names) == 0 {
+		return Providers(), nil
+	}
+
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	selected := make([]Provider, 0, len(names))
+	for _, name := range names {
+		p, ok := providers[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
+
+func init() {
+	Register(&ViaCEPProvider{})
+	Register(&ApiCEPProvider{})
+	Register(&BrasilAPIProvider{})
+	Register(&OpenCEPProvider{})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ViaCEPProvider queries http://viacep.com.br.
+type ViaCEPProvider struct{}
+
+func (ViaCEPProvider) Name() string { return "viacep" }
+
+func (ViaCEPProvider) BuildRequest(ctx context.Context, cep string) (*http.Request, error) {
+	url := "http://viacep.com.br/ws/" + cep + "/json/"
+	return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+}
+
+func (p ViaCEPProvider) Parse(resp *http.Response) (*CEPInfo, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", p.Name(), resp.StatusCode)
+	}
+
+	var body struct {
+		Erro       bool   `json:"erro"`
+		CEP        string `json:"cep"`
+		Logradouro string `json:"logradouro"`
+		Bairro     string `json:"bairro"`
+		Localidade string `json:"localidade"`
+		UF         string `json:"uf"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	if body.Erro {
+		return nil, fmt.Errorf("%s: cep not found", p.Name())
+	}
+
+	return &CEPInfo{
+		CEP:        body.CEP,
+		Logradouro: body.Logradouro,
+		Bairro:     body.Bairro,
+		Localidade: body.Localidade,
+		UF:         body.UF,
+		Source:     p.Name(),
+	}, nil
+}
+
+// ApiCEPProvider queries https://apicep.com.
+type ApiCEPProvider struct{}
+
+func (ApiCEPProvider) Name() string { return "apicep" }
+
+func (ApiCEPProvider) BuildRequest(ctx context.Context, cep string) (*http.Request, error) {
+	url := "https://cdn.apicep.com/file/apicep/" + cep + ".json"
+	return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+}
+
+func (p ApiCEPProvider) Parse(resp *http.Response) (*CEPInfo, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", p.Name(), resp.StatusCode)
+	}
+
+	var body struct {
+		Status   int    `json:"status"`
+		OK       bool   `json:"ok"`
+		Code     string `json:"code"`
+		State    string `json:"state"`
+		City     string `json:"city"`
+		District string `json:"district"`
+		Address  string `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	if !body.OK {
+		return nil, fmt.Errorf("%s: cep not found", p.Name())
+	}
+
+	return &CEPInfo{
+		CEP:        body.Code,
+		Logradouro: body.Address,
+		Bairro:     body.District,
+		Localidade: body.City,
+		UF:         body.State,
+		Source:     p.Name(),
+	}, nil
+}
+
+// BrasilAPIProvider queries https://brasilapi.com.br.
+type BrasilAPIProvider struct{}
+
+func (BrasilAPIProvider) Name() string { return "brasilapi" }
+
+func (BrasilAPIProvider) BuildRequest(ctx context.Context, cep string) (*http.Request, error) {
+	url := "https://brasilapi.com.br/api/cep/v1/" + cep
+	return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+}
+
+func (p BrasilAPIProvider) Parse(resp *http.Response) (*CEPInfo, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", p.Name(), resp.StatusCode)
+	}
+
+	var body struct {
+		CEP          string `json:"cep"`
+		State        string `json:"state"`
+		City         string `json:"city"`
+		Neighborhood string `json:"neighborhood"`
+		Street       string `json:"street"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+
+	return &CEPInfo{
+		CEP:        body.CEP,
+		Logradouro: body.Street,
+		Bairro:     body.Neighborhood,
+		Localidade: body.City,
+		UF:         body.State,
+		Source:     p.Name(),
+	}, nil
+}
+
+// OpenCEPProvider queries https://opencep.com.
+type OpenCEPProvider struct{}
+
+func (OpenCEPProvider) Name() string { return "opencep" }
+
+func (OpenCEPProvider) BuildRequest(ctx context.Context, cep string) (*http.Request, error) {
+	url := "https://opencep.com/v1/" + cep
+	return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+}
+
+func (p OpenCEPProvider) Parse(resp *http.Response) (*CEPInfo, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %d", p.Name(), resp.StatusCode)
+	}
+
+	var body struct {
+		CEP        string `json:"cep"`
+		Logradouro string `json:"logradouro"`
+		Bairro     string `json:"bairro"`
+		Localidade string `json:"localidade"`
+		UF         string `json:"uf"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+
+	return &CEPInfo{
+		CEP:        body.CEP,
+		Logradouro: body.Logradouro,
+		Bairro:     body.Bairro,
+		Localidade: body.Localidade,
+		UF:         body.UF,
+		Source:     p.Name(),
+	}, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvidersIncludesBuiltins(t *testing.T) {
+	names := make([]string, 0)
+	for _, p := range Providers() {
+		names = append(names, p.Name())
+	}
+
+	assert.Contains(t, names, "viacep")
+	assert.Contains(t, names, "apicep")
+	assert.Contains(t, names, "brasilapi")
+	assert.Contains(t, names, "opencep")
+}
+
+func TestSelectProvidersWithEmptyWhitelistReturnsAll(t *testing.T) {
+	provs, err := SelectProviders(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, len(Providers()), len(provs))
+}
+
+func TestSelectProvidersWithUnknownName(t *testing.T) {
+	provs, err := SelectProviders([]string{"does-not-exist"})
+	assert.Nil(t, provs)
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestSelectProvidersWithWhitelist(t *testing.T) {
+	provs, err := SelectProviders([]string{"viacep", "brasilapi"})
+	assert.NoError(t, err)
+	assert.Len(t, provs, 2)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how many times makeRequest retries a transient
+// failure and how long it waits between attempts.
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// Wait returns the delay before the given retry attempt (0-indexed),
+// growing exponentially from Backoff and adding up to 50% jitter so
+// competing providers don't retry in lockstep.
+func (r RetryPolicy) Wait(attempt int) time.Duration {
+	d := r.Backoff * time.Duration(uint64(1)<<uint(attempt))
+	if d <= 0 {
+		return 0
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/2 + 1))
+	return d + jitter
+}
+
+var (
+	retryPolicyMu     sync.RWMutex
+	sharedRetryPolicy = RetryPolicy{MaxRetries: 2, Backoff: 100 * time.Millisecond}
+)
+
+// SetRetryPolicy replaces the retry policy used by makeRequest for every
+// subsequent provider race.
+func SetRetryPolicy(p RetryPolicy) {
+	retryPolicyMu.Lock()
+	defer retryPolicyMu.Unlock()
+	sharedRetryPolicy = p
+}
+
+// GetRetryPolicy returns the retry policy currently used by makeRequest.
+func GetRetryPolicy() RetryPolicy {
+	retryPolicyMu.RLock()
+	defer retryPolicyMu.RUnlock()
+	return sharedRetryPolicy
+}
+
+// isRetriableStatus reports whether an HTTP status code represents a
+// transient server-side failure worth retrying.
+func isRetriableStatus(statusCode int) bool {
+	return statusCode >= 500
+}
+
+// isRetriableErr reports whether err looks like a transient network
+// failure (connection reset, i/o timeout, ...) rather than a permanent one.
+func isRetriableErr(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "connection reset") ||
+		errors.Is(err, http.ErrServerClosed)
+}
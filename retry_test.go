@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyWaitGrowsExponentially(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, Backoff: 10 * time.Millisecond}
+
+	assert.GreaterOrEqual(t, policy.Wait(0), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, policy.Wait(1), 20*time.Millisecond)
+	assert.GreaterOrEqual(t, policy.Wait(2), 40*time.Millisecond)
+}
+
+func TestIsRetriableErr(t *testing.T) {
+	assert.False(t, isRetriableErr(nil))
+	assert.True(t, isRetriableErr(context.DeadlineExceeded))
+	assert.False(t, isRetriableErr(io.EOF))
+}
+
+func TestIsRetriableStatus(t *testing.T) {
+	assert.True(t, isRetriableStatus(500))
+	assert.True(t, isRetriableStatus(503))
+	assert.False(t, isRetriableStatus(404))
+	assert.False(t, isRetriableStatus(200))
+}
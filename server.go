@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// writeDeadlineMargin is reserved out of the server's WriteTimeout so a
+	// JSON error response always has time to serialize and flush before the
+	// deadline actually fires.
+	writeDeadlineMargin = 50 * time.Millisecond
+
+	addrUsage          = "addr is the address the server listens on, e.g. \":8080\"."
+	readTimeoutUsage   = "read-timeout caps how long reading the request (including body) may take."
+	writeTimeoutUsage  = "write-timeout caps how long a /cep lookup may take before the server responds with a 504."
+	idleTimeoutUsage   = "idle-timeout caps how long to keep idle keep-alive connections open."
+	shutdownGraceUsage = "shutdown-grace is how long to wait for in-flight requests to finish on SIGTERM/SIGINT."
+)
+
+var ErrInvalidServeFlags = errors.New("failed to parse serve flags")
+
+// ServeFlags configures the `serve` subcommand.
+type ServeFlags struct {
+	addr          string
+	readTimeout   time.Duration
+	writeTimeout  time.Duration
+	idleTimeout   time.Duration
+	shutdownGrace time.Duration
+	logFormat     string
+	logLevel      string
+	otlpEndpoint  string
+	retries       int
+	retryBackoff  time.Duration
+	dialTimeout   time.Duration
+	tlsTimeout    time.Duration
+	headerTimeout time.Duration
+	cacheSize     int
+	cacheTTL      time.Duration
+	noCache       bool
+}
+
+func parseServeFlags(progname string, args []string) (serveFlags *ServeFlags, usage string, err error) {
+	var addr string
+	var readTimeoutStr, writeTimeoutStr, idleTimeoutStr, shutdownGraceStr string
+	var logFormat, logLevel, otlpEndpoint string
+	var retries int
+	var retryBackoffStr, dialTimeoutStr, tlsTimeoutStr, headerTimeoutStr string
+	var cacheSize int
+	var cacheTTLStr string
+	var noCache bool
+	var buf bytes.Buffer
+
+	flags := flag.NewFlagSet(progname, flag.ContinueOnError)
+	flags.SetOutput(&buf)
+	flags.StringVar(&addr, "addr", ":8080", addrUsage)
+	flags.StringVar(&readTimeoutStr, "read-timeout", "5s", readTimeoutUsage)
+	flags.StringVar(&writeTimeoutStr, "write-timeout", "5s", writeTimeoutUsage)
+	flags.StringVar(&idleTimeoutStr, "idle-timeout", "90s", idleTimeoutUsage)
+	flags.StringVar(&shutdownGraceStr, "shutdown-grace", "10s", shutdownGraceUsage)
+	flags.StringVar(&logFormat, "log-format", "json", logFormatUsage)
+	flags.StringVar(&logLevel, "log-level", "info", logLevelUsage)
+	flags.StringVar(&otlpEndpoint, "otlp-endpoint", "", otlpEndpointUsage)
+	flags.IntVar(&retries, "retries", 2, retriesUsage)
+	flags.StringVar(&retryBackoffStr, "retry-backoff", "100ms", retryBackoffUsage)
+	flags.StringVar(&dialTimeoutStr, "dial-timeout", "5s", dialTimeoutUsage)
+	flags.StringVar(&tlsTimeoutStr, "tls-timeout", "5s", tlsTimeoutUsage)
+	flags.StringVar(&headerTimeoutStr, "header-timeout", "5s", headerTimeoutUsage)
+	flags.IntVar(&cacheSize, "cache-size", 256, cacheSizeUsage)
+	flags.StringVar(&cacheTTLStr, "cache-ttl", defaultCacheTTL.String(), cacheTTLUsage)
+	flags.BoolVar(&noCache, "no-cache", false, noCacheUsage)
+
+	err = flags.Parse(args)
+	if buf.Len() == 0 {
+		flags.PrintDefaults()
+	}
+	usage = buf.String()
+
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidServeFlags, err)
+		return
+	}
+
+	readTimeout, err := time.ParseDuration(readTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: read-timeout", ErrInvalidServeFlags)
+		return
+	}
+
+	writeTimeout, err := time.ParseDuration(writeTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: write-timeout", ErrInvalidServeFlags)
+		return
+	}
+
+	idleTimeout, err := time.ParseDuration(idleTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: idle-timeout", ErrInvalidServeFlags)
+		return
+	}
+
+	shutdownGrace, err := time.ParseDuration(shutdownGraceStr)
+	if err != nil {
+		err = fmt.Errorf("%w: shutdown-grace", ErrInvalidServeFlags)
+		return
+	}
+
+	retryBackoff, err := time.ParseDuration(retryBackoffStr)
+	if err != nil {
+		err = fmt.Errorf("%w: retry-backoff", ErrInvalidServeFlags)
+		return
+	}
+
+	dialTimeout, err := time.ParseDuration(dialTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: dial-timeout", ErrInvalidServeFlags)
+		return
+	}
+
+	tlsTimeout, err := time.ParseDuration(tlsTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: tls-timeout", ErrInvalidServeFlags)
+		return
+	}
+
+	headerTimeout, err := time.ParseDuration(headerTimeoutStr)
+	if err != nil {
+		err = fmt.Errorf("%w: header-timeout", ErrInvalidServeFlags)
+		return
+	}
+
+	cacheTTL, err := time.ParseDuration(cacheTTLStr)
+	if err != nil {
+		err = fmt.Errorf("%w: cache-ttl", ErrInvalidServeFlags)
+		return
+	}
+
+	serveFlags = &ServeFlags{
+		addr:          addr,
+		readTimeout:   readTimeout,
+		writeTimeout:  writeTimeout,
+		idleTimeout:   idleTimeout,
+		shutdownGrace: shutdownGrace,
+		logFormat:     logFormat,
+		logLevel:      logLevel,
+		otlpEndpoint:  otlpEndpoint,
+		retries:       retries,
+		retryBackoff:  retryBackoff,
+		dialTimeout:   dialTimeout,
+		tlsTimeout:    tlsTimeout,
+		headerTimeout: headerTimeout,
+		cacheSize:     cacheSize,
+		cacheTTL:      cacheTTL,
+		noCache:       noCache,
+	}
+	return
+}
+
+// runServe starts the HTTP server mode and blocks until it shuts down,
+// either because ListenAndServe failed or a SIGTERM/SIGINT was handled.
+func runServe(progname string, args []string) error {
+	flags, usage, err := parseServeFlags(progname, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usage)
+		return err
+	}
+
+	if err := configureLogger(flags.logFormat, flags.logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
+	ctx := context.Background()
+	shutdownTracing, err := configureTracing(ctx, flags.otlpEndpoint)
+	if err != nil {
+		logger.Error("failed to configure tracing", "error", err)
+		return err
+	}
+	defer shutdownTracing(ctx)
+
+	SetHTTPClient(NewHTTPClient(ClientConfig{
+		DialTimeout:     flags.dialTimeout,
+		TLSTimeout:      flags.tlsTimeout,
+		HeaderTimeout:   flags.headerTimeout,
+		IdleConnTimeout: 90 * time.Second,
+	}))
+	SetRetryPolicy(RetryPolicy{
+		MaxRetries: flags.retries,
+		Backoff:    flags.retryBackoff,
+	})
+
+	if flags.noCache {
+		SetCache(noopCache{})
+	} else if fileCache, err := NewFileCache(DefaultCachePath(), flags.cacheSize, flags.cacheTTL); err != nil {
+		logger.Warn("failed to open persistent cache, falling back to in-memory", "error", err)
+		SetCache(NewLRUCache(flags.cacheSize, flags.cacheTTL))
+	} else {
+		SetCache(fileCache)
+		// A long-lived server has no per-lookup exit point to flush hit/miss
+		// counters from, so flush what Get has bumped in memory once on
+		// shutdown instead of leaving cache.json stuck at whatever the last
+		// write left it at.
+		defer func() {
+			if err := fileCache.Flush(); err != nil {
+				logger.Warn("failed to flush cache stats", "error", err)
+			}
+		}()
+	}
+
+	srv := &http.Server{
+		Addr:         flags.addr,
+		Handler:      newMux(flags.writeTimeout),
+		ReadTimeout:  flags.readTimeout,
+		WriteTimeout: flags.writeTimeout,
+		IdleTimeout:  flags.idleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("serving", "addr", flags.addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+			return
+		}
+		serveErr <- nil
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case err := <-serveErr:
+		return err
+
+	case sig := <-sigCh:
+		logger.Info("shutting down", "signal", sig.String(), "grace", flags.shutdownGrace)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), flags.shutdownGrace)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
+
+func newMux(writeTimeout time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/cep/", &cepHandler{writeTimeout: writeTimeout})
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.Handle("/metrics", metricsHandler())
+	return mux
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// cepHandler serves GET /cep/{code}. It budgets the lookup against the
+// server's write deadline (minus writeDeadlineMargin) rather than solely
+// against the caller-supplied timeout, so a slow race is always turned into
+// a clean 504 instead of a connection the client sees as truncated.
+type cepHandler struct {
+	writeTimeout time.Duration
+}
+
+func (h *cepHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/cep/")
+	if code == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing cep code")
+		return
+	}
+
+	budget := h.writeTimeout - writeDeadlineMargin
+	if q := r.URL.Query().Get("timeout"); q != "" {
+		requested, err := time.ParseDuration(q)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid timeout")
+			return
+		}
+		if requested < budget {
+			budget = requested
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), budget)
+	defer cancel()
+
+	info, err := GetCEPContext(ctx, code)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logger.Warn("cep lookup timed out", "cep", code, "budget", budget)
+			writeJSONError(w, http.StatusGatewayTimeout, "lookup timed out")
+			return
+		}
+		logger.Error("cep lookup failed", "cep", code, "error", err)
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+// writeJSON writes v with an explicit Content-Length so net/http never
+// falls back to chunked transfer encoding, and flushes immediately so the
+// response is on the wire before any surrounding deadline fires.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
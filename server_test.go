@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	rec := httptest.NewRecorder()
+
+	healthzHandler(rec, req)
+
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.NotEmpty(t, rec.Header().Get("Content-Length"))
+}
+
+func TestCEPHandlerWithMissingCode(t *testing.T) {
+	handler := &cepHandler{writeTimeout: time.Second}
+	req := httptest.NewRequest("GET", "/cep/", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, 400, rec.Code)
+}
+
+func TestCEPHandlerWithWrongMethod(t *testing.T) {
+	handler := &cepHandler{writeTimeout: time.Second}
+	req := httptest.NewRequest("POST", "/cep/69999999", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, 405, rec.Code)
+}